@@ -0,0 +1,195 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GrafanaClient configures how the operator talks to the Grafana instance
+// it manages.
+type GrafanaClient struct {
+	// PreferService skips Route/Ingress discovery and always talks to
+	// Grafana through its in-cluster Service. Ignored when AdminUrl is set.
+	// +optional
+	PreferService bool `json:"preferService,omitempty"`
+
+	// TimeoutSeconds overrides the default HTTP client timeout used for
+	// all Grafana API calls. Defaults to DefaultClientTimeoutSeconds.
+	// +optional
+	TimeoutSeconds *int `json:"timeoutSeconds,omitempty"`
+
+	// AdminUrl picks the strategy used to resolve the Grafana admin API
+	// endpoint. When unset the operator falls back to the automatic
+	// Route -> Ingress -> Service discovery it has always used.
+	// +optional
+	AdminUrl *GrafanaAdminUrl `json:"adminUrl,omitempty"`
+
+	// AdminCredentialsSecretRef points at a Secret with "username" and
+	// "password" keys used to authenticate against Grafana's admin API
+	// (e.g. /api/admin/users, /api/orgs). Required unless the managed
+	// Grafana instance allows anonymous admin access.
+	// +optional
+	AdminCredentialsSecretRef *v1.SecretReference `json:"adminCredentialsSecretRef,omitempty"`
+}
+
+// AdminUrlMode selects which AdminURLResolver resolves the Grafana admin
+// API endpoint.
+type AdminUrlMode string
+
+const (
+	// AdminUrlModeExternal uses the literal Url given in the spec.
+	AdminUrlModeExternal AdminUrlMode = "External"
+	// AdminUrlModeService addresses the in-cluster Service directly,
+	// optionally forcing a scheme/port (e.g. https on a service-mesh
+	// sidecar port).
+	AdminUrlModeService AdminUrlMode = "Service"
+	// AdminUrlModeIngress addresses the Ingress, optionally forcing TLS
+	// and/or an explicit hostname.
+	AdminUrlModeIngress AdminUrlMode = "Ingress"
+	// AdminUrlModeLoadBalancer addresses the Service's LoadBalancer
+	// ingress status directly, bypassing Route/Ingress discovery.
+	AdminUrlModeLoadBalancer AdminUrlMode = "LoadBalancer"
+)
+
+// GrafanaAdminUrl configures how the operator resolves the admin API
+// endpoint for the dashboard/datasource/user/organization controllers.
+type GrafanaAdminUrl struct {
+	// Mode selects the resolver. Defaults to the automatic
+	// Route -> Ingress -> Service chain when empty.
+	// +optional
+	Mode AdminUrlMode `json:"mode,omitempty"`
+
+	// Url is used verbatim when Mode is External.
+	// +optional
+	Url string `json:"url,omitempty"`
+
+	// Scheme overrides http/https when Mode is Service.
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+
+	// Port overrides the Grafana container port when Mode is Service.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// TLS forces https when Mode is Ingress.
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+
+	// Hostname overrides the discovered Ingress hostname when Mode is
+	// Ingress.
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// GrafanaIngress configures the Ingress the operator creates in front of
+// Grafana on vanilla Kubernetes clusters.
+type GrafanaIngress struct {
+	// Hostname is the external hostname to use for the admin URL and the
+	// Ingress rule. When unset, the operator falls back to whatever
+	// hostname or IP the Ingress status reports.
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// GrafanaDashboardRef records a dashboard the operator has installed into
+// Grafana, so the dashboard controller can tell which dashboards it still
+// owns across restarts.
+type GrafanaDashboardRef struct {
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+	Namespace string `json:"namespace"`
+}
+
+// GrafanaSpec defines the desired state of Grafana
+type GrafanaSpec struct {
+	// Client configures how the operator connects to the managed Grafana
+	// instance.
+	// +optional
+	Client *GrafanaClient `json:"client,omitempty"`
+
+	// Ingress configures the Ingress created for this Grafana instance.
+	// +optional
+	Ingress *GrafanaIngress `json:"ingress,omitempty"`
+
+	// DashboardLabelSelector restricts which GrafanaDashboard resources
+	// this instance picks up.
+	// +optional
+	DashboardLabelSelector *metav1.LabelSelector `json:"dashboardLabelSelector,omitempty"`
+
+	// DashboardNamespaceSelector restricts which namespaces GrafanaDashboard
+	// resources are picked up from.
+	// +optional
+	DashboardNamespaceSelector *metav1.LabelSelector `json:"dashboardNamespaceSelector,omitempty"`
+}
+
+// ChangedResource records one resource the last reconcile created, updated
+// or deleted, so `kubectl get grafana -o yaml` can show exactly what
+// changed without scraping logs.
+type ChangedResource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Op   string `json:"op"`
+}
+
+// GrafanaStatus defines the observed state of Grafana
+type GrafanaStatus struct {
+	Phase   StatusPhase `json:"phase,omitempty"`
+	Message string      `json:"message,omitempty"`
+
+	InstalledDashboards map[string][]*GrafanaDashboardRef `json:"installedDashboards,omitempty"`
+
+	// ObservedGeneration is the generation of the Grafana spec that was
+	// last reconciled.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastAppliedTime records when the last reconcile actually mutated
+	// cluster state, as opposed to a no-op pass.
+	// +optional
+	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
+
+	// ChangedResources lists what the last mutating reconcile touched.
+	// +optional
+	ChangedResources []ChangedResource `json:"changedResources,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+
+// Grafana is the Schema for the grafanas API
+type Grafana struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GrafanaSpec   `json:"spec,omitempty"`
+	Status GrafanaStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// GrafanaList contains a list of Grafana
+type GrafanaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Grafana `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Grafana{}, &GrafanaList{})
+}
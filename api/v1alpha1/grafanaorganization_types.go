@@ -0,0 +1,136 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GrafanaOrganizationUser is a statically configured org member.
+type GrafanaOrganizationUser struct {
+	// Login of the Grafana user to add to the organization.
+	Login string `json:"login"`
+
+	// Role the user is granted within the organization (Viewer, Editor, Admin).
+	Role string `json:"role"`
+}
+
+// GrafanaOrganizationGroupMapping maps an IdP group path onto an
+// organization name and the role members of that group should hold.
+type GrafanaOrganizationGroupMapping struct {
+	// GroupPath is the group path as reported by the IdP, e.g. "/sre/oncall".
+	GroupPath string `json:"groupPath"`
+
+	// OrgName is the Grafana organization the group maps to.
+	OrgName string `json:"orgName"`
+
+	// Role is the role members of GroupPath are granted in OrgName.
+	Role string `json:"role"`
+}
+
+// GrafanaOrganizationGroupSync configures periodic reconciliation of
+// organization membership from an OIDC/Keycloak identity provider.
+type GrafanaOrganizationGroupSync struct {
+	// IssuerURL is the OIDC issuer to query for group membership, e.g.
+	// https://keycloak.example.com/auth/realms/main.
+	IssuerURL string `json:"issuerUrl"`
+
+	// ClientCredentialsSecretRef points at a Secret with "clientId" and
+	// "clientSecret" keys used to authenticate against the IdP admin API.
+	ClientCredentialsSecretRef v1.SecretReference `json:"clientCredentialsSecretRef"`
+
+	// GroupMappings maps IdP group paths to organizations and roles.
+	GroupMappings []GrafanaOrganizationGroupMapping `json:"groupMappings,omitempty"`
+
+	// AutoAssignOrgGroupPath is the group path whose members are added to
+	// this organization with the default role when no other mapping
+	// applies.
+	// +optional
+	AutoAssignOrgGroupPath string `json:"autoAssignOrgGroupPath,omitempty"`
+
+	// SyncIntervalSeconds controls how often group membership is
+	// refreshed from the IdP. Defaults to 300 when unset.
+	// +optional
+	SyncIntervalSeconds int `json:"syncIntervalSeconds,omitempty"`
+}
+
+// GrafanaOrganizationSpec defines the desired state of GrafanaOrganization
+type GrafanaOrganizationSpec struct {
+	// Name of the organization in Grafana.
+	Name string `json:"name"`
+
+	// Users is a static list of org members, applied in addition to
+	// anything GroupSync adds or removes.
+	// +optional
+	Users []GrafanaOrganizationUser `json:"users,omitempty"`
+
+	// GroupSync, when set, keeps org membership in sync with an OIDC
+	// provider's group membership.
+	// +optional
+	GroupSync *GrafanaOrganizationGroupSync `json:"groupSync,omitempty"`
+}
+
+// GrafanaOrganizationStatus defines the observed state of GrafanaOrganization
+type GrafanaOrganizationStatus struct {
+	// OrgID is the numeric ID Grafana assigned to the organization.
+	OrgID int64 `json:"orgID,omitempty"`
+
+	// LastGroupSyncTime records when GroupSync last ran successfully.
+	LastGroupSyncTime *metav1.Time `json:"lastGroupSyncTime,omitempty"`
+
+	// GroupManagedUsers lists the logins most recently synced into this
+	// org by GroupSync. It's compared against the next sync's result so a
+	// login that's no longer in any mapped group can be removed again,
+	// since Grafana's org membership API doesn't itself record who added
+	// a member.
+	GroupManagedUsers []string `json:"groupManagedUsers,omitempty"`
+
+	// Phase is the current lifecycle phase of the organization.
+	Phase StatusPhase `json:"phase,omitempty"`
+
+	// Message contains any errors encountered during processing.
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Name",type=string,JSONPath=`.spec.name`
+// +kubebuilder:printcolumn:name="OrgID",type=integer,JSONPath=`.status.orgID`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+
+// GrafanaOrganization is the Schema for the grafanaorganizations API
+type GrafanaOrganization struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GrafanaOrganizationSpec   `json:"spec,omitempty"`
+	Status GrafanaOrganizationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// GrafanaOrganizationList contains a list of GrafanaOrganization
+type GrafanaOrganizationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GrafanaOrganization `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GrafanaOrganization{}, &GrafanaOrganizationList{})
+}
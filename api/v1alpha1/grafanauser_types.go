@@ -0,0 +1,89 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GrafanaUserSpec defines the desired state of GrafanaUser
+type GrafanaUserSpec struct {
+	// Login is the unique username used to authenticate against Grafana.
+	Login string `json:"login"`
+
+	// Email is the user's email address.
+	Email string `json:"email"`
+
+	// Name is the user's display name.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// IsAdmin grants the Grafana server admin role to the user.
+	// +optional
+	IsAdmin bool `json:"isAdmin,omitempty"`
+
+	// PasswordSecretRef points at a Secret containing the password to
+	// create the user with. Only the key named in Key is read.
+	PasswordSecretRef v1.SecretKeySelector `json:"passwordSecretRef"`
+}
+
+// GrafanaUserStatus defines the observed state of GrafanaUser
+type GrafanaUserStatus struct {
+	// UserID is the numeric ID assigned by Grafana, used to address
+	// /api/users/{id} and /api/admin/users/{id} on subsequent reconciles.
+	UserID int64 `json:"userID,omitempty"`
+
+	// SpecHash is a hash of the last applied login/email/name/isAdmin/
+	// password combination, used to detect drift in any of those fields
+	// without re-reading the referenced Secret every reconcile.
+	SpecHash string `json:"specHash,omitempty"`
+
+	// Phase is the current lifecycle phase of the user.
+	Phase StatusPhase `json:"phase,omitempty"`
+
+	// Message contains any errors encountered during processing.
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Login",type=string,JSONPath=`.spec.login`
+// +kubebuilder:printcolumn:name="UserID",type=integer,JSONPath=`.status.userID`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+
+// GrafanaUser is the Schema for the grafanausers API
+type GrafanaUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GrafanaUserSpec   `json:"spec,omitempty"`
+	Status GrafanaUserStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// GrafanaUserList contains a list of GrafanaUser
+type GrafanaUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GrafanaUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GrafanaUser{}, &GrafanaUserList{})
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	stdErr "errors"
+	"fmt"
+
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+	"github.com/integr8ly/grafana-operator/controllers/common"
+	"github.com/integr8ly/grafana-operator/v3/pkg/controller/model"
+)
+
+// AdminURLResolver resolves the URL the operator uses to reach the Grafana
+// admin API. Different deployment topologies (Route, Ingress, a bare
+// Service, an external gateway, a cloud LoadBalancer) need different
+// resolution strategies, so getGrafanaAdminUrl picks one based on
+// cr.Spec.Client.AdminUrl instead of hard-coding a single fallback chain.
+type AdminURLResolver interface {
+	Resolve(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error)
+}
+
+// newAdminURLResolver picks the AdminURLResolver to use for cr. When
+// cr.Spec.Client.AdminUrl is unset it preserves the operator's historical
+// behaviour: prefer the Route, then the Ingress, then fall back to the
+// Service, unless PreferService is set.
+func newAdminURLResolver(cr *grafanav1alpha1.Grafana) AdminURLResolver {
+	var adminUrl *grafanav1alpha1.GrafanaAdminUrl
+	if cr.Spec.Client != nil {
+		adminUrl = cr.Spec.Client.AdminUrl
+	}
+
+	if adminUrl == nil {
+		preferService := cr.Spec.Client != nil && cr.Spec.Client.PreferService
+		return &chainResolver{
+			resolvers: []AdminURLResolver{
+				&RouteResolver{preferService: preferService},
+				&IngressResolver{preferService: preferService, tls: true},
+				&ServiceResolver{},
+			},
+		}
+	}
+
+	switch adminUrl.Mode {
+	case grafanav1alpha1.AdminUrlModeExternal:
+		return &ExternalURLResolver{url: adminUrl.Url}
+	case grafanav1alpha1.AdminUrlModeService:
+		return &ServiceResolver{scheme: adminUrl.Scheme, port: adminUrl.Port}
+	case grafanav1alpha1.AdminUrlModeIngress:
+		return &IngressResolver{tls: adminUrl.TLS, hostname: adminUrl.Hostname}
+	case grafanav1alpha1.AdminUrlModeLoadBalancer:
+		return &LoadBalancerResolver{}
+	default:
+		return &chainResolver{resolvers: []AdminURLResolver{
+			&RouteResolver{}, &IngressResolver{tls: true}, &ServiceResolver{},
+		}}
+	}
+}
+
+// chainResolver tries each resolver in order and returns the first URL
+// resolved, preserving the operator's original Route -> Ingress -> Service
+// fallback behaviour.
+type chainResolver struct {
+	resolvers []AdminURLResolver
+}
+
+func (c *chainResolver) Resolve(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error) {
+	for _, resolver := range c.resolvers {
+		url, err := resolver.Resolve(cr, state)
+		if err == nil && url != "" {
+			return url, nil
+		}
+	}
+
+	return "", stdErr.New("failed to find admin url")
+}
+
+// RouteResolver resolves the admin URL from the OpenShift Route, if present.
+type RouteResolver struct {
+	preferService bool
+}
+
+func (r *RouteResolver) Resolve(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error) {
+	if r.preferService || state.GrafanaRoute == nil {
+		return "", stdErr.New("route not available")
+	}
+
+	return fmt.Sprintf("https://%v", state.GrafanaRoute.Spec.Host), nil
+}
+
+// IngressResolver resolves the admin URL from the Ingress, optionally
+// forcing TLS and/or an explicit hostname.
+type IngressResolver struct {
+	preferService bool
+	tls           bool
+	hostname      string
+}
+
+func (r *IngressResolver) Resolve(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error) {
+	if r.preferService || state.GrafanaIngress == nil {
+		return "", stdErr.New("ingress not available")
+	}
+
+	// spec.client.adminUrl.tls defaults to false (plain http) when Mode is
+	// Ingress and the caller set it explicitly; the legacy automatic chain
+	// (no spec.client.adminUrl at all) constructs this resolver with
+	// tls: true to preserve its historical https-only behaviour.
+	scheme := "http"
+	if r.tls {
+		scheme = "https"
+	}
+
+	hostname := r.hostname
+	if hostname == "" && cr.Spec.Ingress != nil {
+		hostname = cr.Spec.Ingress.Hostname
+	}
+
+	if hostname != "" {
+		return fmt.Sprintf("%s://%v", scheme, hostname), nil
+	}
+
+	for _, ingress := range state.GrafanaIngress.Status.LoadBalancer.Ingress {
+		if ingress.Hostname != "" {
+			return fmt.Sprintf("%s://%v", scheme, ingress.Hostname), nil
+		}
+		return fmt.Sprintf("%s://%v", scheme, ingress.IP), nil
+	}
+
+	return "", stdErr.New("ingress has no hostname or IP yet")
+}
+
+// ServiceResolver resolves the admin URL from the in-cluster Service,
+// optionally forcing a scheme/port (e.g. https behind a mesh sidecar).
+type ServiceResolver struct {
+	scheme string
+	port   int32
+}
+
+func (r *ServiceResolver) Resolve(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error) {
+	if state.GrafanaService == nil {
+		return "", stdErr.New("service not available")
+	}
+
+	scheme := r.scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	port := r.port
+	if port == 0 {
+		port = int32(model.GetGrafanaPort(cr))
+	}
+
+	host := state.GrafanaService.Name
+	if state.GrafanaService.Spec.ClusterIP != "" && state.GrafanaService.Spec.ClusterIP != "None" {
+		host = state.GrafanaService.Spec.ClusterIP
+	}
+
+	return fmt.Sprintf("%s://%v:%d", scheme, host, port), nil
+}
+
+// ExternalURLResolver returns a literal, operator-supplied URL, for Grafana
+// deployments that sit behind a gateway the operator doesn't manage.
+type ExternalURLResolver struct {
+	url string
+}
+
+func (r *ExternalURLResolver) Resolve(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error) {
+	if r.url == "" {
+		return "", stdErr.New("spec.client.adminUrl.url is required when mode is External")
+	}
+
+	return r.url, nil
+}
+
+// LoadBalancerResolver resolves the admin URL from the Service's
+// LoadBalancer status, for clusters that front Grafana with a cloud
+// LoadBalancer Service instead of a Route or Ingress.
+type LoadBalancerResolver struct{}
+
+func (r *LoadBalancerResolver) Resolve(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error) {
+	if state.GrafanaService == nil {
+		return "", stdErr.New("service not available")
+	}
+
+	for _, lb := range state.GrafanaService.Status.LoadBalancer.Ingress {
+		if lb.Hostname != "" {
+			return fmt.Sprintf("https://%v", lb.Hostname), nil
+		}
+		if lb.IP != "" {
+			return fmt.Sprintf("https://%v", lb.IP), nil
+		}
+	}
+
+	return "", stdErr.New("load balancer has no hostname or IP yet")
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+	"github.com/integr8ly/grafana-operator/controllers/common"
+	routev1 "github.com/openshift/api/route/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("newAdminURLResolver", func() {
+	It("picks ExternalURLResolver for Mode External", func() {
+		cr := &grafanav1alpha1.Grafana{Spec: grafanav1alpha1.GrafanaSpec{
+			Client: &grafanav1alpha1.GrafanaClient{
+				AdminUrl: &grafanav1alpha1.GrafanaAdminUrl{
+					Mode: grafanav1alpha1.AdminUrlModeExternal,
+					Url:  "https://grafana.example.com",
+				},
+			},
+		}}
+
+		url, err := newAdminURLResolver(cr).Resolve(cr, &common.ClusterState{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal("https://grafana.example.com"))
+	})
+
+	It("picks ServiceResolver for Mode Service and honours scheme/port overrides", func() {
+		cr := &grafanav1alpha1.Grafana{Spec: grafanav1alpha1.GrafanaSpec{
+			Client: &grafanav1alpha1.GrafanaClient{
+				AdminUrl: &grafanav1alpha1.GrafanaAdminUrl{
+					Mode:   grafanav1alpha1.AdminUrlModeService,
+					Scheme: "https",
+					Port:   3000,
+				},
+			},
+		}}
+		state := &common.ClusterState{
+			GrafanaService: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "grafana-service"},
+				Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.1"},
+			},
+		}
+
+		url, err := newAdminURLResolver(cr).Resolve(cr, state)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal("https://10.0.0.1:3000"))
+	})
+
+	It("falls back to the Route -> Ingress -> Service chain when AdminUrl is unset", func() {
+		cr := &grafanav1alpha1.Grafana{}
+		state := &common.ClusterState{
+			GrafanaRoute: &routev1.Route{Spec: routev1.RouteSpec{Host: "grafana.apps.example.com"}},
+		}
+
+		url, err := newAdminURLResolver(cr).Resolve(cr, state)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal("https://grafana.apps.example.com"))
+	})
+})
+
+var _ = Describe("IngressResolver.Resolve", func() {
+	cr := &grafanav1alpha1.Grafana{}
+	state := func(hostname string) *common.ClusterState {
+		return &common.ClusterState{
+			GrafanaIngress: &networkingv1.Ingress{
+				Status: networkingv1.IngressStatus{
+					LoadBalancer: v1.LoadBalancerStatus{
+						Ingress: []v1.LoadBalancerIngress{{Hostname: hostname}},
+					},
+				},
+			},
+		}
+	}
+
+	It("uses https when tls is true", func() {
+		r := &IngressResolver{tls: true}
+		url, err := r.Resolve(cr, state("grafana.example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal("https://grafana.example.com"))
+	})
+
+	It("uses http when tls is false", func() {
+		r := &IngressResolver{tls: false}
+		url, err := r.Resolve(cr, state("grafana.example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal("http://grafana.example.com"))
+	})
+
+	It("prefers an explicit hostname over the discovered one", func() {
+		r := &IngressResolver{tls: true, hostname: "override.example.com"}
+		url, err := r.Resolve(cr, state("discovered.example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(url).To(Equal("https://override.example.com"))
+	})
+
+	It("errors when preferService is set", func() {
+		r := &IngressResolver{preferService: true}
+		_, err := r.Resolve(cr, state("grafana.example.com"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("errors when the Ingress has no hostname or IP yet", func() {
+		r := &IngressResolver{}
+		_, err := r.Resolve(cr, &common.ClusterState{GrafanaIngress: &networkingv1.Ingress{}})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,74 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterAction is a single create/update/delete step computed by a
+// reconciler's desired-state diff. Execute reports whether it actually
+// mutated cluster state, so a reconcile pass touching nothing can be told
+// apart from one that did.
+type ClusterAction interface {
+	Execute(ctx context.Context, c client.Client, scheme *runtime.Scheme, cr *grafanav1alpha1.Grafana) (changed bool, err error)
+	Describe() grafanav1alpha1.ChangedResource
+}
+
+// ClusterActionRunner runs a list of ClusterAction in order and aggregates
+// which of them actually changed something.
+type ClusterActionRunner struct {
+	ctx    context.Context
+	client client.Client
+	scheme *runtime.Scheme
+	cr     *grafanav1alpha1.Grafana
+}
+
+// NewClusterActionRunner creates a ClusterActionRunner bound to the given
+// client and owning Grafana CR.
+func NewClusterActionRunner(ctx context.Context, client client.Client, scheme *runtime.Scheme, cr *grafanav1alpha1.Grafana) *ClusterActionRunner {
+	return &ClusterActionRunner{
+		ctx:    ctx,
+		client: client,
+		scheme: scheme,
+		cr:     cr,
+	}
+}
+
+// RunAll executes every action in order. It returns the resources that were
+// actually created, updated or deleted, so the caller can tell a no-op pass
+// apart from one that mutated cluster state, and stops at the first error.
+func (r *ClusterActionRunner) RunAll(desiredState []ClusterAction) ([]grafanav1alpha1.ChangedResource, error) {
+	var changedResources []grafanav1alpha1.ChangedResource
+
+	for _, action := range desiredState {
+		changed, err := action.Execute(r.ctx, r.client, r.scheme, r.cr)
+		if err != nil {
+			return changedResources, err
+		}
+
+		if changed {
+			changedResources = append(changedResources, action.Describe())
+		}
+	}
+
+	return changedResources, nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ControllerState is published by the Grafana reconciler whenever it
+// successfully reconciles the Grafana instance, and consumed by the other
+// controllers (user, organization) so they always talk to the same Grafana API
+// endpoint and respect the same client timeout.
+type ControllerState struct {
+	DashboardSelectors         *metav1.LabelSelector
+	DashboardNamespaceSelector *metav1.LabelSelector
+	AdminUrl                   string
+	AdminUser                  string
+	AdminPassword              string
+	GrafanaReady               bool
+	ClientTimeout              int
+}
+
+// controllerStateHolder guards the latest published ControllerState behind
+// a mutex so every dependent controller can read it independently. This is
+// deliberately not a channel: a channel only ever delivers a given value to
+// one receiver, but the user, organization, dashboard and datasource
+// controllers all need to observe the same latest state.
+type controllerStateHolder struct {
+	mu    sync.RWMutex
+	state ControllerState
+}
+
+// Set stores the latest ControllerState published by the Grafana
+// reconciler.
+func (h *controllerStateHolder) Set(state ControllerState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state = state
+}
+
+// Get returns the most recently published ControllerState. Callers should
+// treat a zero-value result (GrafanaReady: false) as "not ready yet".
+func (h *controllerStateHolder) Get() ControllerState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.state
+}
+
+// ControllerEvents holds the latest ControllerState published by the
+// Grafana reconciler's manageSuccess/manageError. Dependent controllers
+// should call Get() rather than caching their own copy, and block their own
+// reconciliation until GrafanaReady is true.
+var ControllerEvents = &controllerStateHolder{}
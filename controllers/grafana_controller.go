@@ -18,34 +18,26 @@ package controllers
 
 import (
 	"context"
-	stdErr "errors"
-	"fmt"
 	"github.com/go-logr/logr"
 	integreatlyorgv1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
 	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
 	"github.com/integr8ly/grafana-operator/controllers/common"
 	"github.com/integr8ly/grafana-operator/v3/pkg/controller/config"
-	"github.com/integr8ly/grafana-operator/v3/pkg/controller/model"
 	routev1 "github.com/openshift/api/route/v1"
 	v12 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
-	v1beta12 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/tools/record"
-	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
-	"sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
-	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
-)
 
 const ControllerName = "grafana-controller"
 const DefaultClientTimeoutSeconds = 5
@@ -53,13 +45,15 @@ const DefaultClientTimeoutSeconds = 5
 // GrafanaReconciler reconciles a Grafana object
 type GrafanaReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=integreatly.org.integreatly.org,resources=grafanas,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=integreatly.org.integreatly.org,resources=grafanas/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=integreatly.org.integreatly.org,resources=grafanas/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -72,30 +66,30 @@ type GrafanaReconciler struct {
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.7.0/pkg/reconcile
 func (r *GrafanaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	instance := &grafanav1alpha1.Grafana{}
-	err := r.client.Get(r.context, request.NamespacedName, instance)
+	err := r.Get(ctx, req.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Stop the dashboard controller from reconciling when grafana is not installed
-			r.config.RemoveConfigItem(config.ConfigDashboardLabelSelector)
-			r.config.Cleanup(true)
+			config.GetControllerConfig().RemoveConfigItem(config.ConfigDashboardLabelSelector)
+			config.GetControllerConfig().Cleanup(true)
 
-			common.ControllerEvents <- common.ControllerState{
+			common.ControllerEvents.Set(common.ControllerState{
 				GrafanaReady: false,
-			}
+			})
 
-			return reconcile.Result{}, nil
+			return ctrl.Result{}, nil
 		}
-		return reconcile.Result{}, err
+		return ctrl.Result{}, err
 	}
 
 	cr := instance.DeepCopy()
 
 	// Read current state
 	currentState := common.NewClusterState()
-	err = currentState.Read(r.context, cr, r.client)
+	err = currentState.Read(ctx, cr, r.Client)
 	if err != nil {
-		log.Error(err, "error reading state")
-		return r.manageError(cr, err, request)
+		r.Log.Error(err, "error reading state")
+		return r.manageError(ctx, cr, err)
 	}
 
 	// Get the actions required to reach the desired state
@@ -103,126 +97,104 @@ func (r *GrafanaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	desiredState := reconciler.Reconcile(currentState, cr)
 
 	// Run the actions to reach the desired state
-	actionRunner := common.NewClusterActionRunner(r.context, r.client, r.scheme, cr)
-	err = actionRunner.RunAll(desiredState)
+	actionRunner := common.NewClusterActionRunner(ctx, r.Client, r.Scheme, cr)
+	changedResources, err := actionRunner.RunAll(desiredState)
 	if err != nil {
-		return r.manageError(cr, err, request)
+		return r.manageError(ctx, cr, err)
 	}
 
 	// Run the config map reconciler to discover jsonnet libraries
 	err = reconcileConfigMaps(cr, r)
 	if err != nil {
-		return r.manageError(cr, err, request)
+		return r.manageError(ctx, cr, err)
 	}
 
-	return r.manageSuccess(cr, currentState, request)
+	return r.manageSuccess(ctx, cr, currentState, changedResources)
 }
-func (r *ReconcileGrafana) manageError(cr *grafanav1alpha1.Grafana, issue error, request reconcile.Request) (reconcile.Result, error) {
-	r.recorder.Event(cr, "Warning", "ProcessingError", issue.Error())
+
+func (r *GrafanaReconciler) manageError(ctx context.Context, cr *grafanav1alpha1.Grafana, issue error) (ctrl.Result, error) {
+	r.Recorder.Event(cr, "Warning", "ProcessingError", issue.Error())
 	cr.Status.Phase = grafanav1alpha1.PhaseFailing
 	cr.Status.Message = issue.Error()
 
-	instance := &grafanav1alpha1.Grafana{}
-	err := r.client.Get(r.context, request.NamespacedName, instance)
-	if err != nil {
-		return reconcile.Result{}, err
-	}
-
-	if !reflect.DeepEqual(cr.Status, instance.Status) {
-		err := r.client.Status().Update(r.context, cr)
-		if err != nil {
-			// Ignore conflicts, resource might just be outdated.
-			if errors.IsConflict(err) {
-				err = nil
-			}
-			return reconcile.Result{}, err
+	if err := r.Status().Update(ctx, cr); err != nil {
+		// Ignore conflicts, resource might just be outdated.
+		if errors.IsConflict(err) {
+			return ctrl.Result{RequeueAfter: config.RequeueDelay}, nil
 		}
+		return ctrl.Result{}, err
 	}
 
-	r.config.InvalidateDashboards()
+	config.GetControllerConfig().InvalidateDashboards()
 
-	common.ControllerEvents <- common.ControllerState{
+	common.ControllerEvents.Set(common.ControllerState{
 		GrafanaReady: false,
-	}
+	})
 
-	return reconcile.Result{RequeueAfter: config.RequeueDelay}, nil
+	return ctrl.Result{RequeueAfter: config.RequeueDelay}, nil
 }
 
-// Try to find a suitable url to grafana
-func (r *ReconcileGrafana) getGrafanaAdminUrl(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error) {
-	// If preferService is true, we skip the routes and try to access grafana
-	// by using the service.
-	preferService := false
-	if cr.Spec.Client != nil {
-		preferService = cr.Spec.Client.PreferService
-	}
+// Try to find a suitable url to grafana. The actual strategy is pluggable
+// via spec.client.adminUrl; see AdminURLResolver for the available modes.
+func (r *GrafanaReconciler) getGrafanaAdminUrl(cr *grafanav1alpha1.Grafana, state *common.ClusterState) (string, error) {
+	return newAdminURLResolver(cr).Resolve(cr, state)
+}
 
-	// First try to use the route if it exists. Prefer the route because it also works
-	// when running the operator outside of the cluster
-	if state.GrafanaRoute != nil && !preferService {
-		return fmt.Sprintf("https://%v", state.GrafanaRoute.Spec.Host), nil
+// lookupAdminCredentials resolves the admin user/password the user,
+// organization and dashboard/datasource controllers authenticate to
+// Grafana's admin API with. Returns empty strings when
+// spec.client.adminCredentialsSecretRef is unset, for Grafana instances that
+// allow anonymous admin access.
+func (r *GrafanaReconciler) lookupAdminCredentials(ctx context.Context, cr *grafanav1alpha1.Grafana) (string, string, error) {
+	if cr.Spec.Client == nil || cr.Spec.Client.AdminCredentialsSecretRef == nil {
+		return "", "", nil
 	}
 
-	// Try the ingress first if on vanilla Kubernetes
-	if state.GrafanaIngress != nil && !preferService {
-		// If provided, use the hostname from the CR
-		if cr.Spec.Ingress != nil && cr.Spec.Ingress.Hostname != "" {
-			return fmt.Sprintf("https://%v", cr.Spec.Ingress.Hostname), nil
-		}
-
-		// Otherwise try to find something suitable, hostname or IP
-		for _, ingress := range state.GrafanaIngress.Status.LoadBalancer.Ingress {
-			if ingress.Hostname != "" {
-				return fmt.Sprintf("https://%v", ingress.Hostname), nil
-			}
-			return fmt.Sprintf("https://%v", ingress.IP), nil
-		}
+	ref := cr.Spec.Client.AdminCredentialsSecretRef
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = cr.Namespace
 	}
 
-	var servicePort = int32(model.GetGrafanaPort(cr))
-
-	// Otherwise rely on the service
-	if state.GrafanaService != nil && state.GrafanaService.Spec.ClusterIP != "" && state.GrafanaService.Spec.ClusterIP != "None" {
-		return fmt.Sprintf("http://%v:%d", state.GrafanaService.Spec.ClusterIP,
-			servicePort), nil
-	} else if state.GrafanaService != nil {
-		return fmt.Sprintf("http://%v:%d", state.GrafanaService.Name,
-			servicePort), nil
+	secret := &v1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+		return "", "", err
 	}
 
-	return "", stdErr.New("failed to find admin url")
+	return string(secret.Data["username"]), string(secret.Data["password"]), nil
 }
 
-func (r *ReconcileGrafana) manageSuccess(cr *grafanav1alpha1.Grafana, state *common.ClusterState, request reconcile.Request) (reconcile.Result, error) {
+func (r *GrafanaReconciler) manageSuccess(ctx context.Context, cr *grafanav1alpha1.Grafana, state *common.ClusterState, changedResources []grafanav1alpha1.ChangedResource) (ctrl.Result, error) {
 	cr.Status.Phase = grafanav1alpha1.PhaseReconciling
 	cr.Status.Message = "success"
+	cr.Status.ObservedGeneration = cr.Generation
+
+	if len(changedResources) > 0 {
+		now := metav1.Now()
+		cr.Status.LastAppliedTime = &now
+		cr.Status.ChangedResources = changedResources
+	}
 
 	// Only update the status if the dashboard controller had a chance to sync the cluster
 	// dashboards first. Otherwise reuse the existing dashboard config from the CR.
-	if r.config.GetConfigBool(config.ConfigGrafanaDashboardsSynced, false) {
-		cr.Status.InstalledDashboards = r.config.Dashboards
+	controllerConfig := config.GetControllerConfig()
+	if controllerConfig.GetConfigBool(config.ConfigGrafanaDashboardsSynced, false) {
+		cr.Status.InstalledDashboards = controllerConfig.Dashboards
 	} else {
-		if r.config.Dashboards == nil {
-			r.config.SetDashboards(make(map[string][]*grafanav1alpha1.GrafanaDashboardRef))
+		if controllerConfig.Dashboards == nil {
+			controllerConfig.SetDashboards(make(map[string][]*grafanav1alpha1.GrafanaDashboardRef))
 		}
 	}
 
-	instance := &grafanav1alpha1.Grafana{}
-	err := r.client.Get(r.context, request.NamespacedName, instance)
+	// Make the Grafana API URL available to the dashboard controller
+	url, err := r.getGrafanaAdminUrl(cr, state)
 	if err != nil {
-		return r.manageError(cr, err, request)
+		return r.manageError(ctx, cr, err)
 	}
 
-	if !reflect.DeepEqual(cr.Status, instance.Status) {
-		err := r.client.Status().Update(r.context, cr)
-		if err != nil {
-			return r.manageError(cr, err, request)
-		}
-	}
-	// Make the Grafana API URL available to the dashboard controller
-	url, err := r.getGrafanaAdminUrl(cr, state)
+	adminUser, adminPassword, err := r.lookupAdminCredentials(ctx, cr)
 	if err != nil {
-		return r.manageError(cr, err, request)
+		return r.manageError(ctx, cr, err)
 	}
 
 	// Publish controller state
@@ -230,6 +202,8 @@ func (r *ReconcileGrafana) manageSuccess(cr *grafanav1alpha1.Grafana, state *com
 		DashboardSelectors:         cr.Spec.DashboardLabelSelector,
 		DashboardNamespaceSelector: cr.Spec.DashboardNamespaceSelector,
 		AdminUrl:                   url,
+		AdminUser:                  adminUser,
+		AdminPassword:              adminPassword,
 		GrafanaReady:               true,
 		ClientTimeout:              DefaultClientTimeoutSeconds,
 	}
@@ -242,16 +216,69 @@ func (r *ReconcileGrafana) manageSuccess(cr *grafanav1alpha1.Grafana, state *com
 		controllerState.ClientTimeout = seconds
 	}
 
-	common.ControllerEvents <- controllerState
+	common.ControllerEvents.Set(controllerState)
+
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if len(changedResources) > 0 {
+		r.Log.Info("reconciled cluster state", "changed", changedResources)
+	} else {
+		r.Log.V(1).Info("desired cluster state met, nothing changed")
+	}
+
+	return ctrl.Result{RequeueAfter: config.RequeueDelay}, nil
+}
 
-	log.V(1).Info("desired cluster state met")
+// grafanaOwnerNameAnnotation and grafanaOwnerNamespaceAnnotation name the
+// Grafana instance a GrafanaDataSource or GrafanaDashboard belongs to, since
+// those CRs are not Kubernetes-owned via an OwnerReference.
+// enqueueOwningGrafana reads them; this controller does not set them.
+const (
+	grafanaOwnerNameAnnotation      = "grafana-operator/owner-name"
+	grafanaOwnerNamespaceAnnotation = "grafana-operator/owner-namespace"
+)
 
-	return reconcile.Result{RequeueAfter: config.RequeueDelay}, nil
+// enqueueOwningGrafana maps a child CR (GrafanaDataSource, GrafanaDashboard)
+// back to a reconcile.Request for the Grafana instance named by its owner
+// annotations, so deleting the child triggers an immediate re-reconcile of
+// the parent instead of waiting for RequeueDelay.
+func enqueueOwningGrafana(obj client.Object) []reconcile.Request {
+	annotations := obj.GetAnnotations()
+	name := annotations[grafanaOwnerNameAnnotation]
+	namespace := annotations[grafanaOwnerNamespaceAnnotation]
+	if name == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{
+		NamespacedName: client.ObjectKey{Name: name, Namespace: namespace},
+	}}
 }
+
+// routeAPIPresent reports whether the OpenShift Route CRD is registered with
+// the cluster the manager is connected to, so SetupWithManager can skip
+// watching routev1.Route on vanilla Kubernetes.
+func routeAPIPresent(mgr ctrl.Manager) bool {
+	_, err := mgr.GetRESTMapper().RESTMapping(schema.GroupKind{Group: routev1.GroupVersion.Group, Kind: "Route"}, routev1.GroupVersion.Version)
+	return err == nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *GrafanaReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&integreatlyorgv1alpha1.Grafana{}).
-		Complete(r)
+		Owns(&v12.Deployment{}).
+		Owns(&v1.Service{}).
+		Owns(&networkingv1.Ingress{}).
+		Watches(&source.Kind{Type: &integreatlyorgv1alpha1.GrafanaDataSource{}}, handler.EnqueueRequestsFromMapFunc(enqueueOwningGrafana)).
+		Watches(&source.Kind{Type: &integreatlyorgv1alpha1.GrafanaDashboard{}}, handler.EnqueueRequestsFromMapFunc(enqueueOwningGrafana))
+
+	if routeAPIPresent(mgr) {
+		builder = builder.Owns(&routev1.Route{})
+	}
+
+	return builder.Complete(r)
 }
 
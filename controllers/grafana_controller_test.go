@@ -0,0 +1,148 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controllerutil"
+)
+
+const (
+	grafanaName      = "watch-test-grafana"
+	grafanaNamespace = "default"
+	timeout          = time.Second * 10
+	interval         = time.Millisecond * 250
+)
+
+// These specs assert that deleting a child Deployment/Service/Ingress/Route
+// owned by a real Grafana instance triggers an immediate re-reconcile of that
+// instance via the Owns() watches registered in SetupWithManager, rather than
+// waiting for the next RequeueDelay tick. The owning Grafana's
+// Status.LastAppliedTime is used as the signal that a reconcile ran after the
+// delete; manageSuccess only advances it when that reconcile reports at least
+// one changed resource, so a reconcile that changes nothing does not satisfy
+// these specs.
+var _ = Describe("Grafana controller child-resource watches", func() {
+	ctx := context.Background()
+	key := types.NamespacedName{Name: grafanaName, Namespace: grafanaNamespace}
+
+	var cr *grafanav1alpha1.Grafana
+
+	BeforeEach(func() {
+		cr = &grafanav1alpha1.Grafana{
+			ObjectMeta: metav1.ObjectMeta{Name: grafanaName, Namespace: grafanaNamespace},
+		}
+		Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+		Eventually(func() error {
+			return k8sClient.Get(ctx, key, cr)
+		}, timeout, interval).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		_ = k8sClient.Delete(ctx, cr)
+	})
+
+	// expectWatchTriggersReconcile creates obj as a child owned by cr,
+	// records the owning Grafana's LastAppliedTime, deletes obj, and asserts
+	// that LastAppliedTime advances past the delete - proof the Owns() watch
+	// enqueued a fresh reconcile that changed cluster state, rather than
+	// relying on envtest's own delete/get semantics.
+	expectWatchTriggersReconcile := func(obj client.Object) {
+		Expect(controllerutil.SetControllerReference(cr, obj, scheme.Scheme)).To(Succeed())
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+
+		beforeDelete := time.Now()
+		Expect(k8sClient.Delete(ctx, obj)).To(Succeed())
+
+		Eventually(func() bool {
+			current := &grafanav1alpha1.Grafana{}
+			if err := k8sClient.Get(ctx, key, current); err != nil {
+				return false
+			}
+			return current.Status.LastAppliedTime != nil && current.Status.LastAppliedTime.After(beforeDelete)
+		}, timeout, interval).Should(BeTrue())
+	}
+
+	It("reconciles the owning Grafana when a Deployment it owns is deleted", func() {
+		expectWatchTriggersReconcile(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: grafanaName + "-deployment", Namespace: grafanaNamespace},
+		})
+	})
+
+	It("reconciles the owning Grafana when a Service it owns is deleted", func() {
+		expectWatchTriggersReconcile(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: grafanaName + "-service", Namespace: grafanaNamespace},
+		})
+	})
+
+	It("reconciles the owning Grafana when an Ingress it owns is deleted", func() {
+		expectWatchTriggersReconcile(&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: grafanaName + "-ingress", Namespace: grafanaNamespace},
+		})
+	})
+
+	It("reconciles the owning Grafana when a Route it owns is deleted", func() {
+		if err := k8sClient.List(ctx, &routev1.RouteList{}, client.InNamespace(grafanaNamespace)); err != nil {
+			Skip("route.openshift.io is not registered with this envtest: " + err.Error())
+		}
+
+		expectWatchTriggersReconcile(&routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: grafanaName + "-route", Namespace: grafanaNamespace},
+		})
+	})
+})
+
+var _ = Describe("enqueueOwningGrafana", func() {
+	It("maps a child CR to a request for its owner annotations", func() {
+		obj := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "some-datasource",
+				Namespace: "monitoring",
+				Annotations: map[string]string{
+					grafanaOwnerNameAnnotation:      grafanaName,
+					grafanaOwnerNamespaceAnnotation: grafanaNamespace,
+				},
+			},
+		}
+
+		requests := enqueueOwningGrafana(obj)
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].NamespacedName).To(Equal(types.NamespacedName{Name: grafanaName, Namespace: grafanaNamespace}))
+	})
+
+	It("returns no requests when the owner annotation is missing", func() {
+		obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "monitoring"}}
+
+		Expect(enqueueOwningGrafana(obj)).To(BeEmpty())
+	})
+})
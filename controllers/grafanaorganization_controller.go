@@ -0,0 +1,313 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+	"github.com/integr8ly/grafana-operator/controllers/common"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controllerutil"
+)
+
+const grafanaOrganizationFinalizer = "grafanaorganization.integreatly.org/finalizer"
+
+// GrafanaOrganizationReconciler reconciles a GrafanaOrganization object
+type GrafanaOrganizationReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// groupSyncWorkers tracks the running group-sync goroutine per
+	// GrafanaOrganization so a spec change can cancel and restart it.
+	groupSyncWorkers map[string]context.CancelFunc
+}
+
+// +kubebuilder:rbac:groups=integreatly.org,resources=grafanaorganizations,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=integreatly.org,resources=grafanaorganizations/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=integreatly.org,resources=grafanaorganizations/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+func (r *GrafanaOrganizationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	controllerState := common.ControllerEvents.Get()
+
+	cr := &grafanav1alpha1.GrafanaOrganization{}
+	err := r.Get(ctx, req.NamespacedName, cr)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			r.stopGroupSync(req.NamespacedName.String())
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Finalization must run even when the owning Grafana is gone or
+	// unreachable - otherwise a GrafanaOrganization deleted alongside its
+	// Grafana (e.g. during namespace teardown) can never drop its
+	// finalizer once GrafanaReady latches false, permanently blocking
+	// deletion.
+	if !cr.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, cr)
+	}
+
+	if !controllerState.GrafanaReady {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(cr, grafanaOrganizationFinalizer) {
+		controllerutil.AddFinalizer(cr, grafanaOrganizationFinalizer)
+		if err := r.Update(ctx, cr); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	orgClient := r.orgClient(controllerState)
+
+	if cr.Status.OrgID == 0 {
+		orgID, err := orgClient.createOrg(cr.Spec.Name)
+		if err != nil {
+			return r.manageError(ctx, cr, err)
+		}
+		cr.Status.OrgID = orgID
+	}
+
+	for _, user := range cr.Spec.Users {
+		if err := orgClient.ensureMember(cr.Status.OrgID, user.Login, user.Role); err != nil {
+			return r.manageError(ctx, cr, err)
+		}
+		r.Recorder.Eventf(cr, "Normal", "UserSynced", "ensured %s has role %s in org %s", user.Login, user.Role, cr.Spec.Name)
+	}
+
+	if cr.Spec.GroupSync != nil {
+		r.startGroupSync(req.NamespacedName.String(), cr)
+	} else {
+		r.stopGroupSync(req.NamespacedName.String())
+	}
+
+	return r.manageSuccess(ctx, cr, controllerState)
+}
+
+func (r *GrafanaOrganizationReconciler) finalize(ctx context.Context, cr *grafanav1alpha1.GrafanaOrganization) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(cr, grafanaOrganizationFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	r.stopGroupSync(cr.Namespace + "/" + cr.Name)
+
+	controllerutil.RemoveFinalizer(cr, grafanaOrganizationFinalizer)
+	if err := r.Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *GrafanaOrganizationReconciler) manageError(ctx context.Context, cr *grafanav1alpha1.GrafanaOrganization, issue error) (ctrl.Result, error) {
+	r.Recorder.Event(cr, "Warning", "ProcessingError", issue.Error())
+	cr.Status.Phase = grafanav1alpha1.PhaseFailing
+	cr.Status.Message = issue.Error()
+
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+}
+
+func (r *GrafanaOrganizationReconciler) manageSuccess(ctx context.Context, cr *grafanav1alpha1.GrafanaOrganization, controllerState common.ControllerState) (ctrl.Result, error) {
+	cr.Status.Phase = grafanav1alpha1.PhaseReconciling
+	cr.Status.Message = "success"
+
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: time.Duration(controllerState.ClientTimeout) * time.Second}, nil
+}
+
+func (r *GrafanaOrganizationReconciler) orgClient(controllerState common.ControllerState) *grafanaOrgClient {
+	return &grafanaOrgClient{
+		adminUrl:      controllerState.AdminUrl,
+		adminUser:     controllerState.AdminUser,
+		adminPassword: controllerState.AdminPassword,
+		http: &http.Client{
+			Timeout: time.Duration(controllerState.ClientTimeout) * time.Second,
+		},
+	}
+}
+
+// grafanaOrgClient is a thin wrapper around the Grafana org API.
+type grafanaOrgClient struct {
+	adminUrl      string
+	adminUser     string
+	adminPassword string
+	http          *http.Client
+}
+
+type grafanaOrgCreateResponse struct {
+	OrgID int64 `json:"orgId"`
+}
+
+func (c *grafanaOrgClient) createOrg(name string) (int64, error) {
+	body, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.do(http.MethodPost, "/api/orgs", body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var created grafanaOrgCreateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return 0, err
+	}
+
+	return created.OrgID, nil
+}
+
+type grafanaOrgMember struct {
+	UserID int64  `json:"userId"`
+	Login  string `json:"login"`
+	Role   string `json:"role"`
+}
+
+func (c *grafanaOrgClient) listMembers(orgID int64) ([]grafanaOrgMember, error) {
+	resp, err := c.do(http.MethodGet, fmt.Sprintf("/api/orgs/%d/users", orgID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var members []grafanaOrgMember
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// ensureMember adds login to the org with the given role, or patches its
+// role if it's already a member with a different one. Grafana's add-member
+// endpoint returns a conflict for a login that's already a member, so the
+// membership list is always checked first rather than treating that
+// response as success-or-fail.
+func (c *grafanaOrgClient) ensureMember(orgID int64, login, role string) error {
+	members, err := c.listMembers(orgID)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if !strings.EqualFold(member.Login, login) {
+			continue
+		}
+		if member.Role == role {
+			return nil
+		}
+		return c.updateMemberRole(orgID, member.UserID, role)
+	}
+
+	return c.addMember(orgID, login, role)
+}
+
+func (c *grafanaOrgClient) addMember(orgID int64, login, role string) error {
+	body, err := json.Marshal(map[string]string{"loginOrEmail": login, "role": role})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(http.MethodPost, fmt.Sprintf("/api/orgs/%d/users", orgID), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+func (c *grafanaOrgClient) updateMemberRole(orgID, userID int64, role string) error {
+	body, err := json.Marshal(map[string]string{"role": role})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(http.MethodPatch, fmt.Sprintf("/api/orgs/%d/users/%d", orgID, userID), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+func (c *grafanaOrgClient) removeMember(orgID, userID int64) error {
+	resp, err := c.do(http.MethodDelete, fmt.Sprintf("/api/orgs/%d/users/%d", orgID, userID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+func (c *grafanaOrgClient) do(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.adminUrl+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.adminUser != "" {
+		req.SetBasicAuth(c.adminUser, c.adminPassword)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("grafana API returned status %d for %s %s", resp.StatusCode, method, path)
+	}
+
+	return resp, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GrafanaOrganizationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.groupSyncWorkers = map[string]context.CancelFunc{}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&grafanav1alpha1.GrafanaOrganization{}).
+		Complete(r)
+}
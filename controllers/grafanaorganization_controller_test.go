@@ -0,0 +1,162 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+)
+
+// fakeGrafanaOrgServer serves just enough of the org membership API for
+// ensureMember/removeStaleGroupMembers to exercise against: an in-memory
+// member list for org 1 only, mutated by add/patch/delete.
+func fakeGrafanaOrgServer(members []grafanaOrgMember) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/orgs/1/users", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(members)
+		case http.MethodPost:
+			var body struct {
+				LoginOrEmail string `json:"loginOrEmail"`
+				Role         string `json:"role"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			members = append(members, grafanaOrgMember{UserID: int64(len(members) + 1), Login: body.LoginOrEmail, Role: body.Role})
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/api/orgs/1/users/", func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Path[len("/api/orgs/1/users/"):]
+		switch r.Method {
+		case http.MethodPatch:
+			var body struct {
+				Role string `json:"role"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			for i := range members {
+				if fmt.Sprintf("%d", members[i].UserID) == id {
+					members[i].Role = body.Role
+				}
+			}
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			kept := members[:0]
+			for _, m := range members {
+				if fmt.Sprintf("%d", m.UserID) != id {
+					kept = append(kept, m)
+				}
+			}
+			members = kept
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+var _ = Describe("grafanaOrgClient.ensureMember", func() {
+	It("adds a login that isn't a member yet", func() {
+		server := fakeGrafanaOrgServer(nil)
+		defer server.Close()
+		client := &grafanaOrgClient{adminUrl: server.URL, http: server.Client()}
+
+		Expect(client.ensureMember(1, "jdoe", "Viewer")).To(Succeed())
+
+		members, err := client.listMembers(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(ConsistOf(grafanaOrgMember{UserID: 1, Login: "jdoe", Role: "Viewer"}))
+	})
+
+	It("is a no-op when the login already has the requested role", func() {
+		server := fakeGrafanaOrgServer([]grafanaOrgMember{{UserID: 1, Login: "jdoe", Role: "Editor"}})
+		defer server.Close()
+		client := &grafanaOrgClient{adminUrl: server.URL, http: server.Client()}
+
+		Expect(client.ensureMember(1, "jdoe", "Editor")).To(Succeed())
+
+		members, err := client.listMembers(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(ConsistOf(grafanaOrgMember{UserID: 1, Login: "jdoe", Role: "Editor"}))
+	})
+
+	It("patches the role when the login is already a member with a different one", func() {
+		server := fakeGrafanaOrgServer([]grafanaOrgMember{{UserID: 1, Login: "jdoe", Role: "Viewer"}})
+		defer server.Close()
+		client := &grafanaOrgClient{adminUrl: server.URL, http: server.Client()}
+
+		Expect(client.ensureMember(1, "jdoe", "Admin")).To(Succeed())
+
+		members, err := client.listMembers(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(ConsistOf(grafanaOrgMember{UserID: 1, Login: "jdoe", Role: "Admin"}))
+	})
+})
+
+var _ = Describe("GrafanaOrganizationReconciler.removeStaleGroupMembers", func() {
+	It("removes a previously group-synced login that's no longer desired", func() {
+		server := fakeGrafanaOrgServer([]grafanaOrgMember{
+			{UserID: 1, Login: "alice", Role: "Editor"},
+			{UserID: 2, Login: "bob", Role: "Viewer"},
+		})
+		defer server.Close()
+		client := &grafanaOrgClient{adminUrl: server.URL, http: server.Client()}
+
+		r := &GrafanaOrganizationReconciler{Log: logr.Discard()}
+		cr := &grafanav1alpha1.GrafanaOrganization{
+			Status: grafanav1alpha1.GrafanaOrganizationStatus{
+				OrgID:             1,
+				GroupManagedUsers: []string{"alice", "bob"},
+			},
+		}
+
+		removed := r.removeStaleGroupMembers(client, cr, map[string]string{"alice": "Editor"})
+		Expect(removed).To(ConsistOf("bob"))
+
+		members, err := client.listMembers(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(ConsistOf(grafanaOrgMember{UserID: 1, Login: "alice", Role: "Editor"}))
+	})
+
+	It("does nothing when every previously managed login is still desired", func() {
+		server := fakeGrafanaOrgServer([]grafanaOrgMember{{UserID: 1, Login: "alice", Role: "Editor"}})
+		defer server.Close()
+		client := &grafanaOrgClient{adminUrl: server.URL, http: server.Client()}
+
+		r := &GrafanaOrganizationReconciler{Log: logr.Discard()}
+		cr := &grafanav1alpha1.GrafanaOrganization{
+			Status: grafanav1alpha1.GrafanaOrganizationStatus{
+				OrgID:             1,
+				GroupManagedUsers: []string{"alice"},
+			},
+		}
+
+		Expect(r.removeStaleGroupMembers(client, cr, map[string]string{"alice": "Editor"})).To(BeEmpty())
+	})
+})
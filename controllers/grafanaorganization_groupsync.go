@@ -0,0 +1,258 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+	"github.com/integr8ly/grafana-operator/controllers/common"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const defaultGroupSyncIntervalSeconds = 300
+
+// startGroupSync launches (or relaunches) the periodic worker that keeps a
+// GrafanaOrganization's membership in sync with its IdP group membership. A
+// previously running worker for the same key is stopped first so spec
+// changes take effect without leaking goroutines.
+func (r *GrafanaOrganizationReconciler) startGroupSync(key string, cr *grafanav1alpha1.GrafanaOrganization) {
+	r.stopGroupSync(key)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.groupSyncWorkers[key] = cancel
+
+	interval := time.Duration(cr.Spec.GroupSync.SyncIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultGroupSyncIntervalSeconds * time.Second
+	}
+
+	name := cr.Name
+	namespace := cr.Namespace
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.syncGroups(ctx, types.NamespacedName{Name: name, Namespace: namespace})
+			}
+		}
+	}()
+}
+
+// stopGroupSync cancels a previously started group-sync worker, if any.
+func (r *GrafanaOrganizationReconciler) stopGroupSync(key string) {
+	if cancel, ok := r.groupSyncWorkers[key]; ok {
+		cancel()
+		delete(r.groupSyncWorkers, key)
+	}
+}
+
+// syncGroups re-reads the GrafanaOrganization, fetches current group
+// membership from the configured IdP and reconciles the org's user list to
+// match, promoting or demoting roles as group membership changes.
+func (r *GrafanaOrganizationReconciler) syncGroups(ctx context.Context, name types.NamespacedName) {
+	cr := &grafanav1alpha1.GrafanaOrganization{}
+	if err := r.Get(ctx, name, cr); err != nil {
+		r.Log.Error(err, "group sync: failed to read GrafanaOrganization", "organization", name)
+		return
+	}
+
+	if cr.Spec.GroupSync == nil || cr.Status.OrgID == 0 {
+		return
+	}
+
+	idp, err := r.idpClient(ctx, cr)
+	if err != nil {
+		r.Log.Error(err, "group sync: failed to build IdP client", "organization", name)
+		return
+	}
+
+	orgClient := r.orgClient(common.ControllerEvents.Get())
+
+	// Build the full desired login -> role mapping first so an explicit
+	// group mapping always wins over the auto-assign default, and so
+	// removals below can be computed from one consistent set instead of
+	// per-mapping.
+	desiredRoles := map[string]string{}
+
+	for _, mapping := range cr.Spec.GroupSync.GroupMappings {
+		if mapping.OrgName != cr.Spec.Name {
+			continue
+		}
+
+		members, err := idp.groupMembers(mapping.GroupPath)
+		if err != nil {
+			r.Log.Error(err, "group sync: failed to list group members", "group", mapping.GroupPath)
+			continue
+		}
+
+		for _, login := range members {
+			desiredRoles[login] = mapping.Role
+		}
+	}
+
+	if path := cr.Spec.GroupSync.AutoAssignOrgGroupPath; path != "" {
+		members, err := idp.groupMembers(path)
+		if err != nil {
+			r.Log.Error(err, "group sync: failed to list default group members", "group", path)
+		} else {
+			for _, login := range members {
+				if _, alreadyMapped := desiredRoles[login]; !alreadyMapped {
+					desiredRoles[login] = "Viewer"
+				}
+			}
+		}
+	}
+
+	for login, role := range desiredRoles {
+		if err := orgClient.ensureMember(cr.Status.OrgID, login, role); err != nil {
+			r.Log.Error(err, "group sync: failed to sync member", "login", login)
+			continue
+		}
+		r.Recorder.Eventf(cr, "Normal", "GroupSynced", "added/updated %s as %s", login, role)
+	}
+
+	// Remove anyone group sync previously added who is no longer in any
+	// mapped group or the auto-assign default. Grafana's org membership
+	// API doesn't record who added a member, so GroupManagedUsers from the
+	// last sync is the only record of what group sync itself owns.
+	if removed := r.removeStaleGroupMembers(orgClient, cr, desiredRoles); len(removed) > 0 {
+		r.Recorder.Eventf(cr, "Normal", "GroupSynced", "removed %v, no longer in a mapped group", removed)
+	}
+
+	managedUsers := make([]string, 0, len(desiredRoles))
+	for login := range desiredRoles {
+		managedUsers = append(managedUsers, login)
+	}
+	sort.Strings(managedUsers)
+	cr.Status.GroupManagedUsers = managedUsers
+
+	now := metav1.Now()
+	cr.Status.LastGroupSyncTime = &now
+	if err := r.Status().Update(ctx, cr); err != nil {
+		r.Log.Error(err, "group sync: failed to update status", "organization", name)
+	}
+}
+
+// removeStaleGroupMembers removes any login that group sync added on a
+// previous run (cr.Status.GroupManagedUsers) but that isn't in this run's
+// desiredRoles, and returns the logins it removed.
+func (r *GrafanaOrganizationReconciler) removeStaleGroupMembers(orgClient *grafanaOrgClient, cr *grafanav1alpha1.GrafanaOrganization, desiredRoles map[string]string) []string {
+	var stale []string
+	for _, login := range cr.Status.GroupManagedUsers {
+		if _, stillDesired := desiredRoles[login]; !stillDesired {
+			stale = append(stale, login)
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	members, err := orgClient.listMembers(cr.Status.OrgID)
+	if err != nil {
+		r.Log.Error(err, "group sync: failed to list members for removal", "organization", cr.Name)
+		return nil
+	}
+
+	var removed []string
+	for _, login := range stale {
+		for _, member := range members {
+			if !strings.EqualFold(member.Login, login) {
+				continue
+			}
+			if err := orgClient.removeMember(cr.Status.OrgID, member.UserID); err != nil {
+				r.Log.Error(err, "group sync: failed to remove stale member", "login", login)
+				continue
+			}
+			removed = append(removed, login)
+		}
+	}
+
+	return removed
+}
+
+// idpClient builds an oidcGroupClient for the configured issuer using the
+// credentials from the referenced Secret.
+func (r *GrafanaOrganizationReconciler) idpClient(ctx context.Context, cr *grafanav1alpha1.GrafanaOrganization) (*oidcGroupClient, error) {
+	ref := cr.Spec.GroupSync.ClientCredentialsSecretRef
+
+	secret := &v1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cr.Namespace}, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oidcGroupClient{
+		issuerURL:    cr.Spec.GroupSync.IssuerURL,
+		clientID:     string(secret.Data["clientId"]),
+		clientSecret: string(secret.Data["clientSecret"]),
+		http:         &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// oidcGroupClient queries group membership with a GET of
+// {issuerURL}/group-membership?path={groupPath}, authenticated with HTTP
+// basic auth using the client ID and secret, and expects a JSON array of
+// logins in response. It does not call Keycloak's admin REST API
+// (/admin/realms/{realm}/groups/{id}/members) and does not obtain an OAuth
+// access token.
+type oidcGroupClient struct {
+	issuerURL    string
+	clientID     string
+	clientSecret string
+	http         *http.Client
+}
+
+func (c *oidcGroupClient) groupMembers(groupPath string) ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.issuerURL+"/group-membership?path="+groupPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("idp returned status %d for group %s", resp.StatusCode, groupPath)
+	}
+
+	var members []string
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
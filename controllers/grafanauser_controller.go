@@ -0,0 +1,343 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+	"github.com/integr8ly/grafana-operator/controllers/common"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controllerutil"
+)
+
+const grafanaUserFinalizer = "grafanauser.integreatly.org/finalizer"
+
+// GrafanaUserReconciler reconciles a GrafanaUser object
+type GrafanaUserReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=integreatly.org,resources=grafanausers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=integreatly.org,resources=grafanausers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=integreatly.org,resources=grafanausers/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+func (r *GrafanaUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	controllerState := common.ControllerEvents.Get()
+
+	cr := &grafanav1alpha1.GrafanaUser{}
+	err := r.Get(ctx, req.NamespacedName, cr)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Finalization must run even when the owning Grafana is gone or
+	// unreachable - otherwise a GrafanaUser deleted alongside its Grafana
+	// (e.g. during namespace teardown) can never drop its finalizer once
+	// GrafanaReady latches false, permanently blocking deletion.
+	if !cr.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, cr, controllerState)
+	}
+
+	if !controllerState.GrafanaReady {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(cr, grafanaUserFinalizer) {
+		controllerutil.AddFinalizer(cr, grafanaUserFinalizer)
+		if err := r.Update(ctx, cr); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	password, err := r.lookupPassword(ctx, cr)
+	if err != nil {
+		return r.manageError(ctx, cr, err)
+	}
+
+	specHash := hashUserSpec(cr, password)
+
+	client := r.grafanaClient(controllerState)
+
+	if cr.Status.UserID == 0 {
+		userID, err := client.createUser(cr, password)
+		// Persist the ID as soon as Grafana hands one back, even if a
+		// later step (e.g. setAdmin) in createUser failed: the user now
+		// exists in Grafana, so the next reconcile must update it rather
+		// than call createUser again with the same login and get a
+		// conflict.
+		if userID != 0 {
+			cr.Status.UserID = userID
+		}
+		if err != nil {
+			return r.manageError(ctx, cr, err)
+		}
+		cr.Status.SpecHash = specHash
+	} else if specHash != cr.Status.SpecHash {
+		// updateUser is idempotent, so it's safe to push the full
+		// login/email/name/isAdmin/password combination any time any of
+		// them drift rather than trying to tell which field changed.
+		if err := client.updateUser(cr.Status.UserID, cr, password); err != nil {
+			return r.manageError(ctx, cr, err)
+		}
+		cr.Status.SpecHash = specHash
+	}
+
+	return r.manageSuccess(ctx, cr, controllerState)
+}
+
+func (r *GrafanaUserReconciler) finalize(ctx context.Context, cr *grafanav1alpha1.GrafanaUser, controllerState common.ControllerState) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(cr, grafanaUserFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	// Without an AdminUrl (the owning Grafana is gone or hasn't reconciled
+	// yet) there's no reachable API to delete the user from; there's also
+	// nothing left to clean up from Grafana's side, so just drop the
+	// finalizer rather than blocking deletion on an unreachable instance.
+	if cr.Status.UserID != 0 && controllerState.AdminUrl != "" {
+		if err := r.grafanaClient(controllerState).deleteUser(cr.Status.UserID); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(cr, grafanaUserFinalizer)
+	if err := r.Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *GrafanaUserReconciler) lookupPassword(ctx context.Context, cr *grafanav1alpha1.GrafanaUser) (string, error) {
+	secret := &v1.Secret{}
+	ref := cr.Spec.PasswordSecretRef
+	err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cr.Namespace}, secret)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %s", cr.Namespace, ref.Name, ref.Key)
+	}
+
+	return string(value), nil
+}
+
+func (r *GrafanaUserReconciler) manageError(ctx context.Context, cr *grafanav1alpha1.GrafanaUser, issue error) (ctrl.Result, error) {
+	r.Recorder.Event(cr, "Warning", "ProcessingError", issue.Error())
+	cr.Status.Phase = grafanav1alpha1.PhaseFailing
+	cr.Status.Message = issue.Error()
+
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+}
+
+func (r *GrafanaUserReconciler) manageSuccess(ctx context.Context, cr *grafanav1alpha1.GrafanaUser, controllerState common.ControllerState) (ctrl.Result, error) {
+	cr.Status.Phase = grafanav1alpha1.PhaseReconciling
+	cr.Status.Message = "success"
+
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: time.Duration(controllerState.ClientTimeout) * time.Second}, nil
+}
+
+// hashUserSpec hashes every field Grafana needs to be told about -
+// login/email/name/isAdmin/password - so drift in any of them (not just the
+// password) is detected on the next reconcile.
+func hashUserSpec(cr *grafanav1alpha1.GrafanaUser, password string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%t\x00%s",
+		cr.Spec.Login, cr.Spec.Email, cr.Spec.Name, cr.Spec.IsAdmin, password)))
+	return fmt.Sprintf("%x", sum)
+}
+
+func (r *GrafanaUserReconciler) grafanaClient(controllerState common.ControllerState) *grafanaUserClient {
+	return &grafanaUserClient{
+		adminUrl:      controllerState.AdminUrl,
+		adminUser:     controllerState.AdminUser,
+		adminPassword: controllerState.AdminPassword,
+		http: &http.Client{
+			Timeout: time.Duration(controllerState.ClientTimeout) * time.Second,
+		},
+	}
+}
+
+// grafanaUserClient is a thin wrapper around the Grafana admin user API.
+type grafanaUserClient struct {
+	adminUrl      string
+	adminUser     string
+	adminPassword string
+	http          *http.Client
+}
+
+type grafanaUserPayload struct {
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email"`
+	Login    string `json:"login"`
+	Password string `json:"password,omitempty"`
+}
+
+type grafanaUserCreateResponse struct {
+	ID int64 `json:"id"`
+}
+
+func (c *grafanaUserClient) createUser(cr *grafanav1alpha1.GrafanaUser, password string) (int64, error) {
+	payload := grafanaUserPayload{
+		Name:     cr.Spec.Name,
+		Email:    cr.Spec.Email,
+		Login:    cr.Spec.Login,
+		Password: password,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.do(http.MethodPost, "/api/admin/users", body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var created grafanaUserCreateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return 0, err
+	}
+
+	if cr.Spec.IsAdmin {
+		if err := c.setAdmin(created.ID, true); err != nil {
+			return created.ID, err
+		}
+	}
+
+	return created.ID, nil
+}
+
+func (c *grafanaUserClient) updateUser(id int64, cr *grafanav1alpha1.GrafanaUser, password string) error {
+	payload := grafanaUserPayload{
+		Name:  cr.Spec.Name,
+		Email: cr.Spec.Email,
+		Login: cr.Spec.Login,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(http.MethodPut, fmt.Sprintf("/api/users/%d", id), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if password != "" {
+		passwordBody, err := json.Marshal(map[string]string{"password": password})
+		if err != nil {
+			return err
+		}
+		resp, err := c.do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/password", id), passwordBody)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	return c.setAdmin(id, cr.Spec.IsAdmin)
+}
+
+func (c *grafanaUserClient) setAdmin(id int64, isAdmin bool) error {
+	body, err := json.Marshal(map[string]bool{"isGrafanaAdmin": isAdmin})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/permissions", id), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+func (c *grafanaUserClient) deleteUser(id int64) error {
+	resp, err := c.do(http.MethodDelete, fmt.Sprintf("/api/admin/users/%d", id), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+func (c *grafanaUserClient) do(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.adminUrl+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.adminUser != "" {
+		req.SetBasicAuth(c.adminUser, c.adminPassword)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("grafana API returned status %d for %s %s", resp.StatusCode, method, path)
+	}
+
+	return resp, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GrafanaUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&grafanav1alpha1.GrafanaUser{}).
+		Complete(r)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	grafanav1alpha1 "github.com/integr8ly/grafana-operator/api/v1alpha1"
+)
+
+var _ = Describe("hashUserSpec", func() {
+	baseUser := func() *grafanav1alpha1.GrafanaUser {
+		return &grafanav1alpha1.GrafanaUser{Spec: grafanav1alpha1.GrafanaUserSpec{
+			Login: "jdoe",
+			Email: "jdoe@example.com",
+			Name:  "Jane Doe",
+		}}
+	}
+
+	It("is stable for the same login/email/name/isAdmin/password", func() {
+		Expect(hashUserSpec(baseUser(), "s3cret")).To(Equal(hashUserSpec(baseUser(), "s3cret")))
+	})
+
+	It("changes when the email changes", func() {
+		changed := baseUser()
+		changed.Spec.Email = "someone-else@example.com"
+		Expect(hashUserSpec(changed, "s3cret")).NotTo(Equal(hashUserSpec(baseUser(), "s3cret")))
+	})
+
+	It("changes when the name changes", func() {
+		changed := baseUser()
+		changed.Spec.Name = "J. Doe"
+		Expect(hashUserSpec(changed, "s3cret")).NotTo(Equal(hashUserSpec(baseUser(), "s3cret")))
+	})
+
+	It("changes when isAdmin changes", func() {
+		changed := baseUser()
+		changed.Spec.IsAdmin = true
+		Expect(hashUserSpec(changed, "s3cret")).NotTo(Equal(hashUserSpec(baseUser(), "s3cret")))
+	})
+
+	It("changes when the password changes", func() {
+		Expect(hashUserSpec(baseUser(), "different")).NotTo(Equal(hashUserSpec(baseUser(), "s3cret")))
+	})
+})
+
+var _ = Describe("grafanaUserClient.do", func() {
+	It("sends basic auth when an admin user is configured", func() {
+		var gotAuthHeader string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotAuthHeader = r.Header.Get("Authorization")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := &grafanaUserClient{adminUrl: server.URL, adminUser: "admin", adminPassword: "secret", http: server.Client()}
+		_, err := client.do(http.MethodGet, "/api/users/1", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gotAuthHeader).NotTo(BeEmpty())
+	})
+
+	It("sends no auth header when no admin user is configured", func() {
+		var gotAuthHeader string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotAuthHeader = r.Header.Get("Authorization")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := &grafanaUserClient{adminUrl: server.URL, http: server.Client()}
+		_, err := client.do(http.MethodGet, "/api/users/1", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gotAuthHeader).To(BeEmpty())
+	})
+})